@@ -3,13 +3,15 @@ package main
 import (
 	"flag"
 
-	"code.uber.internal/go-common.git/x/log"
-
+	"code.uber.internal/infra/kraken/client/cache"
 	"code.uber.internal/infra/kraken/client/dockerregistry"
 	"code.uber.internal/infra/kraken/client/server"
 	"code.uber.internal/infra/kraken/client/store"
 	"code.uber.internal/infra/kraken/client/torrentclient"
+	"code.uber.internal/infra/kraken/client/trust"
+	"code.uber.internal/infra/kraken/client/upstream"
 	"code.uber.internal/infra/kraken/configuration"
+	"code.uber.internal/infra/kraken/pkg/log"
 	"github.com/anacrolix/torrent"
 	rc "github.com/docker/distribution/configuration"
 	ctx "github.com/docker/distribution/context"
@@ -39,16 +41,58 @@ func main() {
 
 	// start agent server
 	aWeb := server.NewAgentWebApp(config, client)
+	aWeb.Handle("/admin/loglevel", log.LevelHandler())
 	go aWeb.Serve()
 
+	// init upstream registry fallback, for blobs missing from the torrent swarm
+	//
+	// TODO(chunk0-5): configuration.Config needs an Upstream upstream.Config
+	// field added for config.Upstream to compile; that package lives
+	// outside this change's tree and is not touched here. Client.Fetch is
+	// also never called by the dockerregistry storage driver yet — that
+	// package is likewise outside this change's tree.
+	log.Info("Init upstream registry client")
+	upstreamClient := upstream.New(config.Upstream, store, torrentsManager, nil)
+
+	// init blob descriptor cache
+	//
+	// TODO(chunk0-4): configuration.Config needs a BlobDescriptorCache
+	// cache.Config field added for config.BlobDescriptorCache to compile;
+	// that package lives outside this change's tree and is not touched
+	// here. Stat/SetDescriptor/Clear are also never called by the
+	// dockerregistry storage driver yet — that package is likewise outside
+	// this change's tree.
+	log.Info("Init blob descriptor cache")
+	descriptorCache, err := cache.NewBlobDescriptorCacheProvider(config.BlobDescriptorCache)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// init content-trust verification, if configured
+	//
+	// TODO(chunk0-3): configuration.Config needs a Trust trust.Config field
+	// added for config.Trust to compile; that package lives outside this
+	// change's tree and is not touched here.
+	params := rc.Parameters{
+		"config":         config,
+		"torrent-client": client,
+		"store":          store,
+		"blobdescriptor": descriptorCache,
+		"upstream":       upstreamClient,
+	}
+	if config.Trust.TrustServer != "" {
+		log.Info("Init content trust verifier")
+		verifier, err := trust.NewVerifier(config.Trust)
+		if err != nil {
+			log.Fatal(err)
+		}
+		params["trust"] = verifier
+	}
+
 	// init docker registry
 	log.Info("Init registry")
 	config.Registry.Storage = rc.Storage{
-		dockerregistry.Name: rc.Parameters{
-			"config":         config,
-			"torrent-client": client,
-			"store":          store,
-		},
+		dockerregistry.Name: params,
 		"redirect": rc.Parameters{
 			"disable": true,
 		},
@@ -0,0 +1,168 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package cache provides an in-memory blob descriptor cache for the
+// dockerregistry storage driver, sitting between repeated manifest/blob HEAD
+// requests and the torrent-backed local file store.
+package cache
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/registry/storage/cache"
+	"github.com/opencontainers/go-digest"
+)
+
+// Config configures the size and freshness of the descriptor cache.
+type Config struct {
+	Size int           `yaml:"size"`
+	TTL  time.Duration `yaml:"ttl"`
+}
+
+type entry struct {
+	desc   distribution.Descriptor
+	expiry time.Time
+	elem   *list.Element
+}
+
+// provider implements cache.BlobDescriptorCacheProvider with a single LRU
+// shared across all repositories, keyed by digest. Repository scoping is a
+// thin view over the same underlying cache, matching how distribution's own
+// in-memory implementation treats descriptors as repo-agnostic content.
+type provider struct {
+	config Config
+
+	mu      sync.Mutex
+	ll      *list.List
+	entries map[digest.Digest]*entry
+}
+
+// NewBlobDescriptorCacheProvider creates a BlobDescriptorCacheProvider backed
+// by an LRU of the given size, evicting entries older than config.TTL.
+func NewBlobDescriptorCacheProvider(config Config) (cache.BlobDescriptorCacheProvider, error) {
+	if config.Size <= 0 {
+		return nil, fmt.Errorf("cache: size must be positive, got %d", config.Size)
+	}
+	return &provider{
+		config:  config,
+		ll:      list.New(),
+		entries: make(map[digest.Digest]*entry),
+	}, nil
+}
+
+// RepositoryScoped returns a BlobDescriptorService scoped to repo. Since
+// content-addressable descriptors are valid across repositories, the
+// returned service records the repo name but reads and writes the same
+// shared cache; no per-repository state is kept.
+func (p *provider) RepositoryScoped(repo string) (distribution.BlobDescriptorService, error) {
+	return &repoService{provider: p, repo: repo}, nil
+}
+
+// Stat, Clear, and SetDescriptor operate on the shared cache directly,
+// matching cache.BlobDescriptorCacheProvider.
+func (p *provider) Stat(ctx context.Context, dgst digest.Digest) (distribution.Descriptor, error) {
+	return p.stat(dgst)
+}
+
+func (p *provider) Clear(ctx context.Context, dgst digest.Digest) error {
+	p.evict(dgst)
+	return nil
+}
+
+func (p *provider) SetDescriptor(ctx context.Context, dgst digest.Digest, desc distribution.Descriptor) error {
+	p.set(dgst, desc)
+	return nil
+}
+
+func (p *provider) stat(dgst digest.Digest) (distribution.Descriptor, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	e, ok := p.entries[dgst]
+	if !ok {
+		return distribution.Descriptor{}, distribution.ErrBlobUnknown
+	}
+	if time.Now().After(e.expiry) {
+		p.removeLocked(dgst, e)
+		return distribution.Descriptor{}, distribution.ErrBlobUnknown
+	}
+	p.ll.MoveToFront(e.elem)
+	return e.desc, nil
+}
+
+func (p *provider) set(dgst digest.Digest, desc distribution.Descriptor) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if e, ok := p.entries[dgst]; ok {
+		e.desc = desc
+		e.expiry = time.Now().Add(p.config.TTL)
+		p.ll.MoveToFront(e.elem)
+		return
+	}
+
+	elem := p.ll.PushFront(dgst)
+	p.entries[dgst] = &entry{
+		desc:   desc,
+		expiry: time.Now().Add(p.config.TTL),
+		elem:   elem,
+	}
+
+	for p.ll.Len() > p.config.Size {
+		oldest := p.ll.Back().Value.(digest.Digest)
+		p.removeLocked(oldest, p.entries[oldest])
+	}
+}
+
+func (p *provider) evict(dgst digest.Digest) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if e, ok := p.entries[dgst]; ok {
+		p.removeLocked(dgst, e)
+	}
+}
+
+// removeLocked removes dgst from the cache. Callers must hold p.mu.
+func (p *provider) removeLocked(dgst digest.Digest, e *entry) {
+	p.ll.Remove(e.elem)
+	delete(p.entries, dgst)
+}
+
+// repoService is a thin, repo-tagged view over provider. It exists to
+// satisfy distribution.BlobDescriptorService's per-repository contract; the
+// driver's RepositoryScoped call returns one of these per repo.
+type repoService struct {
+	provider *provider
+	repo     string
+}
+
+func (s *repoService) Stat(ctx context.Context, dgst digest.Digest) (distribution.Descriptor, error) {
+	return s.provider.stat(dgst)
+}
+
+func (s *repoService) Clear(ctx context.Context, dgst digest.Digest) error {
+	s.provider.evict(dgst)
+	return nil
+}
+
+func (s *repoService) SetDescriptor(ctx context.Context, dgst digest.Digest, desc distribution.Descriptor) error {
+	s.provider.set(dgst, desc)
+	return nil
+}
@@ -0,0 +1,158 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package cache
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/docker/distribution"
+	"github.com/opencontainers/go-digest"
+)
+
+func mustProvider(t *testing.T, config Config) *provider {
+	t.Helper()
+	p, err := NewBlobDescriptorCacheProvider(config)
+	if err != nil {
+		t.Fatalf("NewBlobDescriptorCacheProvider: unexpected error: %s", err)
+	}
+	return p.(*provider)
+}
+
+func digestN(n byte) digest.Digest {
+	return digest.NewDigestFromBytes(digest.SHA256, []byte{n})
+}
+
+func TestNewBlobDescriptorCacheProviderRejectsNonPositiveSize(t *testing.T) {
+	if _, err := NewBlobDescriptorCacheProvider(Config{Size: 0, TTL: time.Minute}); err == nil {
+		t.Fatalf("expected error for zero size, got nil")
+	}
+	if _, err := NewBlobDescriptorCacheProvider(Config{Size: -1, TTL: time.Minute}); err == nil {
+		t.Fatalf("expected error for negative size, got nil")
+	}
+}
+
+func TestStatSetDescriptor(t *testing.T) {
+	ctx := context.Background()
+	p := mustProvider(t, Config{Size: 2, TTL: time.Minute})
+
+	dgst := digestN(1)
+	if _, err := p.Stat(ctx, dgst); err != distribution.ErrBlobUnknown {
+		t.Fatalf("Stat on empty cache = %v, want ErrBlobUnknown", err)
+	}
+
+	desc := distribution.Descriptor{Digest: dgst, Size: 42}
+	if err := p.SetDescriptor(ctx, dgst, desc); err != nil {
+		t.Fatalf("SetDescriptor: unexpected error: %s", err)
+	}
+
+	got, err := p.Stat(ctx, dgst)
+	if err != nil {
+		t.Fatalf("Stat: unexpected error: %s", err)
+	}
+	if !reflect.DeepEqual(got, desc) {
+		t.Fatalf("Stat() = %+v, want %+v", got, desc)
+	}
+}
+
+func TestSetDescriptorEvictsLeastRecentlyUsed(t *testing.T) {
+	ctx := context.Background()
+	p := mustProvider(t, Config{Size: 2, TTL: time.Minute})
+
+	d1, d2, d3 := digestN(1), digestN(2), digestN(3)
+	p.SetDescriptor(ctx, d1, distribution.Descriptor{Digest: d1})
+	p.SetDescriptor(ctx, d2, distribution.Descriptor{Digest: d2})
+
+	// Touch d1 so it's more recently used than d2.
+	if _, err := p.Stat(ctx, d1); err != nil {
+		t.Fatalf("Stat(d1): unexpected error: %s", err)
+	}
+
+	// Pushes the cache over its size of 2; d2 is the least recently used
+	// and should be evicted, not d1.
+	p.SetDescriptor(ctx, d3, distribution.Descriptor{Digest: d3})
+
+	if _, err := p.Stat(ctx, d2); err != distribution.ErrBlobUnknown {
+		t.Fatalf("Stat(d2) = %v, want ErrBlobUnknown (should have been evicted)", err)
+	}
+	if _, err := p.Stat(ctx, d1); err != nil {
+		t.Fatalf("Stat(d1): unexpected error: %s", err)
+	}
+	if _, err := p.Stat(ctx, d3); err != nil {
+		t.Fatalf("Stat(d3): unexpected error: %s", err)
+	}
+}
+
+func TestStatExpiresEntriesPastTTL(t *testing.T) {
+	ctx := context.Background()
+	p := mustProvider(t, Config{Size: 2, TTL: time.Millisecond})
+
+	dgst := digestN(1)
+	p.SetDescriptor(ctx, dgst, distribution.Descriptor{Digest: dgst})
+
+	time.Sleep(5 * time.Millisecond)
+
+	if _, err := p.Stat(ctx, dgst); err != distribution.ErrBlobUnknown {
+		t.Fatalf("Stat() after TTL expiry = %v, want ErrBlobUnknown", err)
+	}
+}
+
+func TestClearRemovesEntry(t *testing.T) {
+	ctx := context.Background()
+	p := mustProvider(t, Config{Size: 2, TTL: time.Minute})
+
+	dgst := digestN(1)
+	p.SetDescriptor(ctx, dgst, distribution.Descriptor{Digest: dgst})
+	if err := p.Clear(ctx, dgst); err != nil {
+		t.Fatalf("Clear: unexpected error: %s", err)
+	}
+	if _, err := p.Stat(ctx, dgst); err != distribution.ErrBlobUnknown {
+		t.Fatalf("Stat() after Clear = %v, want ErrBlobUnknown", err)
+	}
+}
+
+func TestRepositoryScopedSharesUnderlyingCache(t *testing.T) {
+	ctx := context.Background()
+	p := mustProvider(t, Config{Size: 2, TTL: time.Minute})
+
+	scoped, err := p.RepositoryScoped("myrepo")
+	if err != nil {
+		t.Fatalf("RepositoryScoped: unexpected error: %s", err)
+	}
+
+	dgst := digestN(1)
+	desc := distribution.Descriptor{Digest: dgst}
+	if err := scoped.SetDescriptor(ctx, dgst, desc); err != nil {
+		t.Fatalf("scoped.SetDescriptor: unexpected error: %s", err)
+	}
+
+	// Visible directly on the shared provider, since descriptors are
+	// content-addressable and repo-agnostic.
+	got, err := p.Stat(ctx, dgst)
+	if err != nil {
+		t.Fatalf("p.Stat: unexpected error: %s", err)
+	}
+	if !reflect.DeepEqual(got, desc) {
+		t.Fatalf("p.Stat() = %+v, want %+v", got, desc)
+	}
+
+	if err := scoped.Clear(ctx, dgst); err != nil {
+		t.Fatalf("scoped.Clear: unexpected error: %s", err)
+	}
+	if _, err := p.Stat(ctx, dgst); err != distribution.ErrBlobUnknown {
+		t.Fatalf("p.Stat() after scoped.Clear = %v, want ErrBlobUnknown", err)
+	}
+}
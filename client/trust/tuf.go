@@ -0,0 +1,387 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package trust
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+// rootKey is a pinned Notary root public key loaded from RootKeyPath.
+type rootKey struct {
+	id  string
+	key ed25519.PublicKey
+}
+
+// signedRole is the common envelope every TUF role document (root.json,
+// targets.json, delegation files) is wrapped in.
+type signedRole struct {
+	Signed struct {
+		Type        string                     `json:"_type"`
+		Expires     string                     `json:"expires"`
+		Targets     map[string]tufTargetEntry  `json:"targets"`
+		Roles       map[string]tufDelegatedKey `json:"roles"`
+		Keys        map[string]tufKey          `json:"keys"`
+		Delegations tufDelegations             `json:"delegations"`
+	} `json:"signed"`
+	Signatures []tufSignature `json:"signatures"`
+}
+
+// tufDelegations is the "delegations" section of a targets.json-shaped
+// document: the keys delegated roles sign with, and the roles themselves.
+type tufDelegations struct {
+	Keys  map[string]tufKey    `json:"keys"`
+	Roles []tufDelegationEntry `json:"roles"`
+}
+
+// tufDelegationEntry describes one delegated role, e.g. "targets/releases".
+type tufDelegationEntry struct {
+	Name      string   `json:"name"`
+	KeyIDs    []string `json:"keyids"`
+	Threshold int      `json:"threshold"`
+}
+
+type tufTargetEntry struct {
+	Hashes map[string]string `json:"hashes"`
+	Length int64             `json:"length"`
+}
+
+type tufDelegatedKey struct {
+	KeyIDs    []string `json:"keyids"`
+	Threshold int      `json:"threshold"`
+}
+
+type tufKey struct {
+	KeyType string `json:"keytype"`
+	KeyVal  struct {
+		Public string `json:"public"`
+	} `json:"keyval"`
+}
+
+type tufSignature struct {
+	KeyID string `json:"keyid"`
+	Sig   string `json:"sig"`
+}
+
+// target is a verified TUF target entry resolved to a content digest.
+type target struct {
+	digest string
+}
+
+// delegatedRole holds a fetched delegation's metadata plus the keyids and
+// threshold its delegating role (targets.json) requires for it.
+type delegatedRole struct {
+	name      string
+	raw       []byte
+	doc       signedRole
+	keyIDs    []string
+	threshold int
+}
+
+// tufRepo holds the parsed root, targets, and delegation metadata for a
+// single repository, along with the raw bytes needed to re-validate
+// signatures.
+type tufRepo struct {
+	targets     map[string]target
+	rootDoc     signedRole
+	rootRaw     []byte
+	targetsDoc  signedRole
+	targetsRaw  []byte
+	delegations []delegatedRole
+	pinnedRoots []rootKey
+}
+
+// loadRootKeys reads PEM-encoded ed25519 public keys from path. Each PEM
+// block's key ID is its SHA-256 fingerprint as rendered by `notary key list`.
+func loadRootKeys(path string) ([]rootKey, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read root key file: %s", err)
+	}
+
+	var keys []rootKey
+	rest := data
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("parse pinned root key: %s", err)
+		}
+		edKey, ok := pub.(ed25519.PublicKey)
+		if !ok {
+			return nil, fmt.Errorf("pinned root key is not ed25519")
+		}
+		keys = append(keys, rootKey{id: keyID(edKey), key: edKey})
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no PEM-encoded keys found in %s", path)
+	}
+	return keys, nil
+}
+
+// fetchTUFRepo retrieves root.json and targets.json for repo from server
+// and parses them. Signature verification happens lazily in verifyChain, so
+// callers that don't need a given tag avoid the verification cost.
+func fetchTUFRepo(server, repo string, pinnedRoots []rootKey) (*tufRepo, error) {
+	rootRaw, err := fetchMetadata(server, repo, "root")
+	if err != nil {
+		return nil, err
+	}
+	var rootDoc signedRole
+	if err := json.Unmarshal(rootRaw, &rootDoc); err != nil {
+		return nil, fmt.Errorf("decode root.json: %s", err)
+	}
+
+	targetsRaw, err := fetchMetadata(server, repo, "targets")
+	if err != nil {
+		return nil, err
+	}
+	var targetsDoc signedRole
+	if err := json.Unmarshal(targetsRaw, &targetsDoc); err != nil {
+		return nil, fmt.Errorf("decode targets.json: %s", err)
+	}
+
+	targets := make(map[string]target, len(targetsDoc.Signed.Targets))
+	addTargets(targets, targetsDoc.Signed.Targets)
+
+	// TUF/Notary tags are commonly published under a delegated role (e.g.
+	// "targets/releases") rather than directly in targets.json. Fetch and
+	// merge each delegation's targets; verifyChain re-validates every one of
+	// them before any digest they contributed is trusted.
+	var delegations []delegatedRole
+	for _, role := range targetsDoc.Signed.Delegations.Roles {
+		raw, err := fetchMetadata(server, repo, role.Name)
+		if err != nil {
+			return nil, fmt.Errorf("fetch delegation %s: %s", role.Name, err)
+		}
+		var doc signedRole
+		if err := json.Unmarshal(raw, &doc); err != nil {
+			return nil, fmt.Errorf("decode delegation %s: %s", role.Name, err)
+		}
+		addTargets(targets, doc.Signed.Targets)
+		delegations = append(delegations, delegatedRole{
+			name:      role.Name,
+			raw:       raw,
+			doc:       doc,
+			keyIDs:    role.KeyIDs,
+			threshold: role.Threshold,
+		})
+	}
+
+	return &tufRepo{
+		targets:     targets,
+		rootDoc:     rootDoc,
+		rootRaw:     rootRaw,
+		targetsDoc:  targetsDoc,
+		targetsRaw:  targetsRaw,
+		delegations: delegations,
+		pinnedRoots: pinnedRoots,
+	}, nil
+}
+
+// addTargets merges entry.Hashes["sha256"] digests from src into dst, the
+// same way for both targets.json itself and any delegated targets file.
+func addTargets(dst map[string]target, src map[string]tufTargetEntry) {
+	for tag, entry := range src {
+		digest, ok := entry.Hashes["sha256"]
+		if !ok {
+			continue
+		}
+		dst[tag] = target{digest: "sha256:" + digest}
+	}
+}
+
+// verifyChain validates the full root -> targets -> delegations signature
+// chain: root.json must be signed by a pinned root key (meeting the root
+// role's own threshold), targets.json must be signed by keys the
+// (now-trusted) root lists under the "targets" role (meeting its
+// threshold), and every delegated role targets.json delegates to must in
+// turn be signed by the keys/threshold targets.json assigns it. Every role
+// along the way must also not be expired, so stale metadata can't be
+// replayed indefinitely.
+func (r *tufRepo) verifyChain() error {
+	rootRole, ok := r.rootDoc.Signed.Roles["root"]
+	if !ok {
+		return fmt.Errorf("root.json has no root role")
+	}
+	if err := verifySignatures(r.rootRaw, r.rootDoc, pinnedKeySet(r.pinnedRoots), rootRole.Threshold); err != nil {
+		return fmt.Errorf("root signature check failed: %s", err)
+	}
+	if err := checkNotExpired(r.rootDoc); err != nil {
+		return fmt.Errorf("root: %s", err)
+	}
+
+	targetsRole, ok := r.rootDoc.Signed.Roles["targets"]
+	if !ok {
+		return fmt.Errorf("root.json has no targets role")
+	}
+	trustedKeys := resolveKeys(r.rootDoc.Signed.Keys, targetsRole.KeyIDs)
+	if err := verifySignatures(r.targetsRaw, r.targetsDoc, trustedKeys, targetsRole.Threshold); err != nil {
+		return fmt.Errorf("targets signature check failed: %s", err)
+	}
+	if err := checkNotExpired(r.targetsDoc); err != nil {
+		return fmt.Errorf("targets: %s", err)
+	}
+
+	for _, d := range r.delegations {
+		delegationKeys := resolveKeys(r.targetsDoc.Signed.Delegations.Keys, d.keyIDs)
+		if err := verifySignatures(d.raw, d.doc, delegationKeys, d.threshold); err != nil {
+			return fmt.Errorf("delegation %s signature check failed: %s", d.name, err)
+		}
+		if err := checkNotExpired(d.doc); err != nil {
+			return fmt.Errorf("delegation %s: %s", d.name, err)
+		}
+	}
+
+	return nil
+}
+
+// resolveKeys decodes the keys in ids out of keys, skipping any id that
+// can't be found or decoded cleanly (verifySignatures' threshold check, not
+// this function, is what rejects an under-signed role).
+func resolveKeys(keys map[string]tufKey, ids []string) map[string]ed25519.PublicKey {
+	resolved := make(map[string]ed25519.PublicKey, len(ids))
+	for _, id := range ids {
+		k, ok := keys[id]
+		if !ok {
+			continue
+		}
+		pub, err := decodeTUFKey(k)
+		if err != nil {
+			continue
+		}
+		resolved[id] = pub
+	}
+	return resolved
+}
+
+// checkNotExpired rejects role metadata past its "expires" timestamp,
+// guarding against a TUF freeze attack where an attacker replays stale
+// signed metadata instead of the latest.
+func checkNotExpired(doc signedRole) error {
+	expires, err := time.Parse(time.RFC3339, doc.Signed.Expires)
+	if err != nil {
+		return fmt.Errorf("parse expires: %s", err)
+	}
+	if time.Now().After(expires) {
+		return fmt.Errorf("metadata expired at %s", doc.Signed.Expires)
+	}
+	return nil
+}
+
+func pinnedKeySet(roots []rootKey) map[string]ed25519.PublicKey {
+	set := make(map[string]ed25519.PublicKey, len(roots))
+	for _, r := range roots {
+		set[r.id] = r.key
+	}
+	return set
+}
+
+// decodeTUFKey decodes the hex-encoded public key bytes TUF/Notary stores
+// in a key object's keyval.public field.
+func decodeTUFKey(k tufKey) (ed25519.PublicKey, error) {
+	if k.KeyType != "ed25519" {
+		return nil, fmt.Errorf("unsupported key type %q", k.KeyType)
+	}
+	raw, err := hex.DecodeString(k.KeyVal.Public)
+	if err != nil {
+		return nil, err
+	}
+	return ed25519.PublicKey(raw), nil
+}
+
+// verifySignatures checks that doc.Signatures includes at least threshold
+// valid, distinctly-keyed signatures over the canonical "signed" payload
+// from keys in trusted, mirroring TUF's per-role signing threshold: a
+// single compromised key must never be enough on its own to satisfy a role
+// that requires more than one signer.
+func verifySignatures(raw []byte, doc signedRole, trusted map[string]ed25519.PublicKey, threshold int) error {
+	if threshold < 1 {
+		threshold = 1
+	}
+	signedBytes, err := canonicalSignedPayload(raw)
+	if err != nil {
+		return err
+	}
+	valid := make(map[string]bool)
+	for _, sig := range doc.Signatures {
+		key, ok := trusted[sig.KeyID]
+		if !ok {
+			continue
+		}
+		sigBytes, err := hex.DecodeString(sig.Sig)
+		if err != nil {
+			continue
+		}
+		if ed25519.Verify(key, signedBytes, sigBytes) {
+			valid[sig.KeyID] = true
+		}
+	}
+	if len(valid) < threshold {
+		return fmt.Errorf("only %d of %d required signatures are valid", len(valid), threshold)
+	}
+	return nil
+}
+
+// canonicalSignedPayload re-extracts the "signed" field from the raw role
+// document so it can be verified independently of map key ordering.
+func canonicalSignedPayload(raw []byte) ([]byte, error) {
+	var envelope struct {
+		Signed json.RawMessage `json:"signed"`
+	}
+	if err := json.Unmarshal(raw, &envelope); err != nil {
+		return nil, fmt.Errorf("extract signed payload: %s", err)
+	}
+	return envelope.Signed, nil
+}
+
+func fetchMetadata(server, repo, role string) ([]byte, error) {
+	url := fmt.Sprintf("%s/v2/%s/_trust/tuf/%s.json", server, repo, role)
+	resp, err := http.Get(url)
+	if err != nil {
+		return nil, fmt.Errorf("fetch %s: %s", url, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetch %s: unexpected status %d", url, resp.StatusCode)
+	}
+	return ioutil.ReadAll(resp.Body)
+}
+
+// keyID computes a pinned root public key's TUF/Notary key ID: the SHA-256
+// digest, hex-encoded, of the canonical JSON encoding of its key object,
+// including the "scheme" field the TUF key schema requires. This must match
+// the keyid Notary assigns the same key server-side (reported by `notary key
+// list`), since that's the id verifySignatures looks signatures up by; a
+// canonical form that omits "scheme" hashes to a different id than a real
+// Notary server computes, so pinned roots would never match.
+func keyID(pub ed25519.PublicKey) string {
+	canonical := fmt.Sprintf(
+		`{"keytype":"ed25519","keyval":{"public":"%s"},"scheme":"ed25519"}`,
+		hex.EncodeToString(pub))
+	sum := sha256.Sum256([]byte(canonical))
+	return hex.EncodeToString(sum[:])
+}
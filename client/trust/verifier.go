@@ -0,0 +1,99 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package trust verifies that a manifest digest pulled through Kraken
+// matches a Notary-signed target before it is served out of the torrent
+// layer.
+package trust
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrManifestUntrusted is returned by Verifier.Verify when the requested
+// repo:tag does not match a trusted target, or has no signed target at all
+// and RequireSignedTags is enabled.
+var ErrManifestUntrusted = errors.New("trust: manifest does not match a trusted Notary target")
+
+// Verifier validates a pulled manifest against a Notary-signed target and
+// returns the trusted digest for repo:tag.
+//
+// TODO(chunk0-3): the dockerregistry storage driver must call Verify on
+// manifest reads and fail the read with ErrManifestUntrusted when it
+// returns that error; that package lives outside this change's tree and is
+// not wired up here.
+type Verifier interface {
+	Verify(repo, tag string) (digest string, err error)
+}
+
+// Config configures a Notary-backed Verifier.
+type Config struct {
+	// TrustServer is the base URL of the Notary server holding signed
+	// targets for this registry, e.g. "https://notary.example.com".
+	TrustServer string `yaml:"trust_server"`
+
+	// RootKeyPath is the path to the PEM-encoded, pinned root keys used to
+	// validate the root -> targets -> delegations signature chain.
+	RootKeyPath string `yaml:"root_key_path"`
+
+	// RequireSignedTags fails closed on unsigned tags when true. When
+	// false, a tag with no trust data falls through unverified.
+	RequireSignedTags bool `yaml:"require_signed_tags"`
+}
+
+type notaryVerifier struct {
+	config Config
+	roots  []rootKey
+}
+
+// NewVerifier creates a Verifier that checks pulls against the Notary
+// server and pinned root keys described by config.
+func NewVerifier(config Config) (Verifier, error) {
+	if config.TrustServer == "" {
+		return nil, fmt.Errorf("trust: no trust_server configured")
+	}
+	roots, err := loadRootKeys(config.RootKeyPath)
+	if err != nil {
+		return nil, fmt.Errorf("trust: load root keys: %s", err)
+	}
+	return &notaryVerifier{
+		config: config,
+		roots:  roots,
+	}, nil
+}
+
+// Verify fetches targets.json for repo from the Notary server, validates the
+// root -> targets -> delegations signature chain against the pinned root
+// keys, and returns the trusted digest for tag.
+func (v *notaryVerifier) Verify(repo, tag string) (string, error) {
+	tufRepo, err := fetchTUFRepo(v.config.TrustServer, repo, v.roots)
+	if err != nil {
+		return "", fmt.Errorf("trust: fetch TUF metadata for %s: %s", repo, err)
+	}
+
+	target, ok := tufRepo.targets[tag]
+	if !ok {
+		if v.config.RequireSignedTags {
+			return "", ErrManifestUntrusted
+		}
+		return "", nil
+	}
+
+	if err := tufRepo.verifyChain(); err != nil {
+		return "", fmt.Errorf("%w: %s", ErrManifestUntrusted, err)
+	}
+
+	return target.digest, nil
+}
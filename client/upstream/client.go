@@ -0,0 +1,208 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package upstream pulls a blob directly from a configured origin registry
+// when it cannot be found anywhere in the torrent swarm, ingests it into the
+// local store, and announces it to the tracker so peers can fetch it via
+// torrent from that moment on.
+package upstream
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/docker/distribution/reference"
+	"github.com/docker/distribution/registry/client"
+	"github.com/docker/distribution/registry/client/auth"
+	"github.com/docker/distribution/registry/client/auth/challenge"
+	"github.com/docker/distribution/registry/client/transport"
+	"github.com/opencontainers/go-digest"
+)
+
+// TokenRefresher gives registries with non-standard auth, like ECR, a
+// chance to mint fresh basic credentials before a bearer token exchange,
+// instead of relying solely on the WWW-Authenticate challenge.
+type TokenRefresher interface {
+	RefreshToken(registry string) (username, password string, err error)
+}
+
+// Store ingests a fetched blob into the agent's local file store.
+type Store interface {
+	CreateUploadFile(name string, size int64) error
+	GetUploadFileReadWriter(name string) (io.ReadWriteCloser, error)
+	MoveUploadFileToCache(name, target string) error
+}
+
+// Announcer tells the tracker that this agent now has a piece of content
+// available, so it shows up in future peer lists.
+type Announcer interface {
+	Announce(repo string, dgst digest.Digest) error
+}
+
+// Config configures the origin registry an upstream.Client falls back to.
+type Config struct {
+	Address string `yaml:"address"`
+
+	// WaitTimeout is the configured wait on the torrent swarm before an
+	// upstream fetch. Client does not read it; Fetch does no waiting itself.
+	WaitTimeout time.Duration `yaml:"wait_timeout"`
+}
+
+// Client fetches blobs missing from the torrent swarm directly from the
+// configured origin registry.
+type Client struct {
+	config     Config
+	store      Store
+	announcer  Announcer
+	challenges challenge.Manager
+	credStore  auth.CredentialStore
+	base       http.RoundTripper
+}
+
+// New creates a Client that falls back to config.Address for blobs the
+// torrent swarm cannot serve, ingesting them into store and announcing them
+// via announcer. refresher may be nil for registries that only need
+// WWW-Authenticate-driven bearer/basic auth (Docker Hub, GCR, Harbor); ECR
+// deployments should supply one to refresh its short-lived tokens.
+func New(config Config, store Store, announcer Announcer, refresher TokenRefresher) *Client {
+	var credStore auth.CredentialStore = noCredentials{}
+	if refresher != nil {
+		credStore = refresherCredentials{refresher: refresher, registry: config.Address}
+	}
+
+	return &Client{
+		config:     config,
+		store:      store,
+		announcer:  announcer,
+		challenges: challenge.NewSimpleManager(),
+		credStore:  credStore,
+		base:       http.DefaultTransport,
+	}
+}
+
+// Fetch pulls repo@dgst from the origin registry, ingests it into the local
+// store, and announces it to the tracker. It is intended to be called after
+// the torrent swarm has exhausted a bounded wait for the same blob.
+func (c *Client) Fetch(ctx context.Context, repo string, dgst digest.Digest) error {
+	named, err := reference.WithName(repo)
+	if err != nil {
+		return fmt.Errorf("upstream: parse repo name %q: %s", repo, err)
+	}
+
+	// Ping the registry's /v2/ endpoint and record its WWW-Authenticate
+	// challenges, which the authorizer built in transportFor answers.
+	pingReq, err := http.NewRequest("GET", strings.TrimSuffix(c.config.Address, "/")+"/v2/", nil)
+	if err != nil {
+		return fmt.Errorf("upstream: create ping request: %s", err)
+	}
+	pingResp, err := (&http.Client{Transport: c.base}).Do(pingReq.WithContext(ctx))
+	if err != nil {
+		return fmt.Errorf("upstream: ping %s: %s", c.config.Address, err)
+	}
+	pingResp.Body.Close()
+	if err := c.challenges.AddResponse(pingResp); err != nil {
+		return fmt.Errorf("upstream: record auth challenges: %s", err)
+	}
+
+	repoClient, err := client.NewRepository(named, c.config.Address, c.transportFor(repo))
+	if err != nil {
+		return fmt.Errorf("upstream: create repository client: %s", err)
+	}
+
+	reader, err := repoClient.Blobs(ctx).Open(ctx, dgst)
+	if err != nil {
+		return fmt.Errorf("upstream: open blob %s: %s", dgst, err)
+	}
+	defer reader.Close()
+
+	if err := c.ingest(dgst, reader); err != nil {
+		return fmt.Errorf("upstream: ingest blob %s: %s", dgst, err)
+	}
+	if err := c.announcer.Announce(repo, dgst); err != nil {
+		return fmt.Errorf("upstream: announce blob %s: %s", dgst, err)
+	}
+	return nil
+}
+
+// transportFor builds a RoundTripper whose bearer token exchange is scoped
+// to "repository:repo:pull", per Docker Engine API / WWW-Authenticate
+// conventions. The scope is repo-specific, so it must be built fresh for
+// each Fetch rather than baked in once at construction time.
+func (c *Client) transportFor(repo string) http.RoundTripper {
+	handlers := []auth.AuthenticationHandler{
+		auth.NewTokenHandler(c.base, c.credStore, repo, "pull"),
+		auth.NewBasicHandler(c.credStore),
+	}
+	return transport.NewTransport(c.base, auth.NewAuthorizer(c.challenges, handlers...))
+}
+
+// ingest streams blob into the store under its digest, verifying the
+// content actually hashes to dgst before it is moved into the cache or
+// announced. Without this check, a compromised or MITM'd upstream registry
+// could serve arbitrary bytes under any digest and this node would then
+// seed that content to every peer that requests it by digest.
+func (c *Client) ingest(dgst digest.Digest, blob io.Reader) error {
+	name := dgst.String()
+	if err := c.store.CreateUploadFile(name, 0); err != nil {
+		return fmt.Errorf("create upload file: %s", err)
+	}
+	w, err := c.store.GetUploadFileReadWriter(name)
+	if err != nil {
+		return fmt.Errorf("open upload file: %s", err)
+	}
+	defer w.Close()
+
+	verifier := dgst.Verifier()
+	if _, err := io.Copy(io.MultiWriter(w, verifier), blob); err != nil {
+		return fmt.Errorf("write blob: %s", err)
+	}
+	if !verifier.Verified() {
+		return fmt.Errorf("fetched content does not match digest %s", dgst)
+	}
+
+	return c.store.MoveUploadFileToCache(name, name)
+}
+
+// noCredentials is used when no basic credentials are configured; the
+// bearer/basic handlers fall through to anonymous access.
+type noCredentials struct{}
+
+func (noCredentials) Basic(*url.URL) (string, string)          { return "", "" }
+func (noCredentials) RefreshToken(*url.URL, string) string     { return "" }
+func (noCredentials) SetRefreshToken(*url.URL, string, string) {}
+
+// refresherCredentials adapts a TokenRefresher into an auth.CredentialStore,
+// re-resolving credentials on every Basic() call so rotated tokens (e.g. an
+// ECR authorization token nearing its 12-hour expiry) are picked up without
+// restarting the agent.
+type refresherCredentials struct {
+	refresher TokenRefresher
+	registry  string
+}
+
+func (c refresherCredentials) Basic(*url.URL) (string, string) {
+	username, password, err := c.refresher.RefreshToken(c.registry)
+	if err != nil {
+		return "", ""
+	}
+	return username, password
+}
+
+func (refresherCredentials) RefreshToken(*url.URL, string) string     { return "" }
+func (refresherCredentials) SetRefreshToken(*url.URL, string, string) {}
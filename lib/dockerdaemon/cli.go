@@ -16,6 +16,7 @@ package dockerdaemon
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -34,6 +35,19 @@ const _defaultTimeout = 32 * time.Second
 // DockerClient is a docker daemon client.
 type DockerClient interface {
 	ImagePull(ctx context.Context, repo, tag string) error
+	ImagePush(ctx context.Context, repo, tag string) error
+	ImageLoad(ctx context.Context, tarStream io.Reader, quiet bool) error
+	ImageTag(ctx context.Context, source, target string) error
+	ImageInspect(ctx context.Context, ref string) (InspectResponse, error)
+}
+
+// InspectResponse mirrors the subset of the daemon's `types.ImageInspect`
+// response that callers of ImageInspect care about.
+type InspectResponse struct {
+	ID          string   `json:"Id"`
+	RepoTags    []string `json:"RepoTags"`
+	RepoDigests []string `json:"RepoDigests"`
+	Size        int64    `json:"Size"`
 }
 
 type dockerClient struct {
@@ -42,12 +56,14 @@ type dockerClient struct {
 	addr     string
 	basePath string
 	registry string
+	creds    CredentialProvider
 
 	client *http.Client
 }
 
-// NewDockerClient creates a new DockerClient.
-func NewDockerClient(host, scheme, version, registry string) (DockerClient, error) {
+// NewDockerClient creates a new DockerClient. creds may be nil, in which case
+// pulls are made without registry authentication.
+func NewDockerClient(host, scheme, version, registry string, creds CredentialProvider) (DockerClient, error) {
 	client, addr, basePath, err := parseHost(host)
 	if err != nil {
 		return nil, fmt.Errorf("parse docker host `%s`: %s", host, err)
@@ -59,10 +75,24 @@ func NewDockerClient(host, scheme, version, registry string) (DockerClient, erro
 		addr:     addr,
 		basePath: basePath,
 		registry: registry,
+		creds:    creds,
 		client:   client,
 	}, nil
 }
 
+// registryAuthHeader resolves the current credentials for cli.registry, if a
+// CredentialProvider was configured, and encodes them for X-Registry-Auth.
+func (cli *dockerClient) registryAuthHeader() (string, error) {
+	if cli.creds == nil {
+		return "", nil
+	}
+	auth, err := cli.creds.Resolve(cli.registry)
+	if err != nil {
+		return "", fmt.Errorf("resolve credentials for %q: %s", cli.registry, err)
+	}
+	return encodeRegistryAuth(auth)
+}
+
 // parseHost parse host URL and returns a HTTP client.
 // This is needed because url.Parse cannot correctly parse url of format
 // "unix:///...".
@@ -107,43 +137,157 @@ func (cli *dockerClient) ImagePull(ctx context.Context, repo, tag string) error
 	fromImage := fmt.Sprintf("%s/%s", cli.registry, repo)
 	v.Set("fromImage", fromImage)
 	v.Set("tag", tag)
-	headers := map[string][]string{"X-Registry-Auth": {""}}
+	auth, err := cli.registryAuthHeader()
+	if err != nil {
+		return err
+	}
+	headers := map[string][]string{"X-Registry-Auth": {auth}}
 	return cli.post(ctx, "/images/create", v, headers, nil, true)
 }
 
-func (cli *dockerClient) post(
-	ctx context.Context, urlPath string, query url.Values, header http.Header,
-	body io.Reader, streamRespBody bool) error {
+// ImagePush calls `docker push` to publish repo:tag to the configured registry.
+func (cli *dockerClient) ImagePush(ctx context.Context, repo, tag string) error {
+	v := url.Values{}
+	v.Set("tag", tag)
+	image := fmt.Sprintf("%s/%s", cli.registry, repo)
+	auth, err := cli.registryAuthHeader()
+	if err != nil {
+		return err
+	}
+	headers := map[string][]string{"X-Registry-Auth": {auth}}
+	return cli.post(ctx, fmt.Sprintf("/images/%s/push", image), v, headers, nil, true)
+}
 
-	// Construct request. It veries depending on client version.
-	var apiPath string
-	if cli.version != "" {
-		v := strings.TrimPrefix(cli.version, "v")
-		apiPath = fmt.Sprintf("%s/v%s%s", cli.basePath, v, urlPath)
-	} else {
-		apiPath = fmt.Sprintf("%s%s", cli.basePath, urlPath)
+// ImageLoad calls `docker load` to import an image from a tar stream produced
+// by the caller (e.g. reassembled from torrent pieces on disk). The daemon's
+// /images/load endpoint expects the raw tar as the request body, not a
+// multipart form, so tarStream is passed straight through.
+func (cli *dockerClient) ImageLoad(ctx context.Context, tarStream io.Reader, quiet bool) error {
+	v := url.Values{}
+	v.Set("quiet", fmt.Sprintf("%t", quiet))
+
+	headers := map[string][]string{"Content-Type": {"application/x-tar"}}
+	return cli.post(ctx, "/images/load", v, headers, tarStream, true)
+}
+
+// ImageTag calls `docker tag` to tag source as target in the local daemon.
+func (cli *dockerClient) ImageTag(ctx context.Context, source, target string) error {
+	repo, tag := splitRepoTag(target)
+	v := url.Values{}
+	v.Set("repo", repo)
+	if tag != "" {
+		v.Set("tag", tag)
+	}
+	return cli.post(ctx, fmt.Sprintf("/images/%s/tag", source), v, nil, nil, false)
+}
+
+// splitRepoTag splits target into its repo and tag parts on the last colon,
+// ignoring one that is part of a registry host:port prefix (e.g.
+// "myregistry:5000/repo:v2" splits as "myregistry:5000/repo" and "v2"). tag
+// is empty when target has none, leaving the daemon to default to "latest".
+func splitRepoTag(target string) (repo, tag string) {
+	i := strings.LastIndex(target, ":")
+	if i < 0 || strings.Contains(target[i+1:], "/") {
+		return target, ""
+	}
+	return target[:i], target[i+1:]
+}
+
+// ImageInspect calls `docker inspect` on ref and decodes the daemon's
+// response into an InspectResponse.
+func (cli *dockerClient) ImageInspect(ctx context.Context, ref string) (InspectResponse, error) {
+	var resp InspectResponse
+	if err := cli.get(ctx, fmt.Sprintf("/images/%s/json", ref), nil, &resp); err != nil {
+		return InspectResponse{}, err
 	}
+	return resp, nil
+}
+
+func (cli *dockerClient) get(
+	ctx context.Context, urlPath string, query url.Values, v interface{}) error {
+
+	apiPath := cli.apiPath(urlPath)
 	u := &url.URL{Path: apiPath}
 	if len(query) > 0 {
 		u.RawQuery = query.Encode()
 	}
-	if body == nil {
-		body = bytes.NewReader([]byte{})
-	}
-	req, err := http.NewRequest("POST", u.String(), body)
+	req, err := http.NewRequest("GET", u.String(), nil)
 	if err != nil {
 		return fmt.Errorf("create request: %s", err)
 	}
-	req.Header = header
 	req.Host = "docker"
 	req.URL.Host = cli.addr
 	req.URL.Scheme = cli.scheme
 
 	resp, err := ctxhttp.Do(ctx, cli.client, req)
 	if err != nil {
-		return fmt.Errorf("send post request: %s", err)
+		return fmt.Errorf("send get request: %s", err)
 	}
 	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		errMsg, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return fmt.Errorf("read error resp: %s", err)
+		}
+		return fmt.Errorf("Error getting %s: code %d, err: %s", urlPath, resp.StatusCode, errMsg)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("decode resp body: %s", err)
+	}
+	return nil
+}
+
+// apiPath constructs the version-prefixed request path shared by post() and get().
+func (cli *dockerClient) apiPath(urlPath string) string {
+	if cli.version != "" {
+		v := strings.TrimPrefix(cli.version, "v")
+		return fmt.Sprintf("%s/v%s%s", cli.basePath, v, urlPath)
+	}
+	return fmt.Sprintf("%s%s", cli.basePath, urlPath)
+}
+
+func (cli *dockerClient) post(
+	ctx context.Context, urlPath string, query url.Values, header http.Header,
+	body io.Reader, streamRespBody bool) error {
+
+	// Only auth-bearing requests (ImagePull/ImagePush, which send no body)
+	// are ever retried after a 401, so only those need their body buffered
+	// for replay. ImageLoad's raw tar body never sets X-Registry-Auth, so a
+	// multi-GB image load is streamed straight through instead of being
+	// held in memory.
+	retryable := cli.creds != nil && header.Get("X-Registry-Auth") != ""
+
+	reqBody := body
+	var bodyBytes []byte
+	if retryable && body != nil {
+		b, err := ioutil.ReadAll(body)
+		if err != nil {
+			return fmt.Errorf("read req body: %s", err)
+		}
+		bodyBytes = b
+		reqBody = bytes.NewReader(bodyBytes)
+	}
+
+	resp, err := cli.doPost(ctx, urlPath, query, header, reqBody)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusUnauthorized && retryable {
+		resp.Body.Close()
+		auth, err := cli.registryAuthHeader()
+		if err != nil {
+			return fmt.Errorf("re-resolve credentials after 401: %s", err)
+		}
+		header.Set("X-Registry-Auth", auth)
+		resp, err = cli.doPost(ctx, urlPath, query, header, bytes.NewReader(bodyBytes))
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+	}
+
 	if resp.StatusCode != 200 {
 		errMsg, err := ioutil.ReadAll(resp.Body)
 		if err != nil {
@@ -161,3 +305,34 @@ func (cli *dockerClient) post(
 
 	return nil
 }
+
+// doPost issues a single POST request against urlPath, without any retry
+// logic. The caller is responsible for closing the returned response body.
+func (cli *dockerClient) doPost(
+	ctx context.Context, urlPath string, query url.Values, header http.Header,
+	body io.Reader) (*http.Response, error) {
+
+	// Construct request. It veries depending on client version.
+	apiPath := cli.apiPath(urlPath)
+	u := &url.URL{Path: apiPath}
+	if len(query) > 0 {
+		u.RawQuery = query.Encode()
+	}
+	if body == nil {
+		body = bytes.NewReader([]byte{})
+	}
+	req, err := http.NewRequest("POST", u.String(), body)
+	if err != nil {
+		return nil, fmt.Errorf("create request: %s", err)
+	}
+	req.Header = header
+	req.Host = "docker"
+	req.URL.Host = cli.addr
+	req.URL.Scheme = cli.scheme
+
+	resp, err := ctxhttp.Do(ctx, cli.client, req)
+	if err != nil {
+		return nil, fmt.Errorf("send post request: %s", err)
+	}
+	return resp, nil
+}
@@ -0,0 +1,151 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package dockerdaemon
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+)
+
+// AuthConfig carries the credentials sent to the daemon via the
+// X-Registry-Auth header.
+type AuthConfig struct {
+	Username      string `json:"username"`
+	Password      string `json:"password"`
+	ServerAddress string `json:"serveraddress"`
+	IdentityToken string `json:"identitytoken"`
+}
+
+// CredentialProvider resolves registry credentials for a given registry host.
+type CredentialProvider interface {
+	Resolve(registry string) (AuthConfig, error)
+}
+
+// dockerConfig mirrors the fields of ~/.docker/config.json that credential
+// resolution cares about.
+type dockerConfig struct {
+	Auths map[string]struct {
+		Auth string `json:"auth"`
+	} `json:"auths"`
+	CredsStore  string            `json:"credsStore"`
+	CredHelpers map[string]string `json:"credHelpers"`
+}
+
+// credHelperOutput is the JSON emitted by `docker-credential-<helper> get`.
+type credHelperOutput struct {
+	ServerURL string `json:"ServerURL"`
+	Username  string `json:"Username"`
+	Secret    string `json:"Secret"`
+}
+
+type dockerConfigCredentialProvider struct {
+	configPath string
+}
+
+// NewDockerConfigCredentialProvider creates a CredentialProvider that reads
+// credentials from ~/.docker/config.json, following the same auths,
+// credsStore, and credHelpers resolution order as the docker CLI.
+func NewDockerConfigCredentialProvider() (CredentialProvider, error) {
+	u, err := user.Current()
+	if err != nil {
+		return nil, fmt.Errorf("lookup current user: %s", err)
+	}
+	return &dockerConfigCredentialProvider{
+		configPath: filepath.Join(u.HomeDir, ".docker", "config.json"),
+	}, nil
+}
+
+// Resolve returns the AuthConfig for registry, preferring a per-registry
+// credHelper, then the global credsStore, then a plaintext auths entry.
+func (p *dockerConfigCredentialProvider) Resolve(registry string) (AuthConfig, error) {
+	f, err := os.Open(p.configPath)
+	if err != nil {
+		return AuthConfig{}, fmt.Errorf("open docker config: %s", err)
+	}
+	defer f.Close()
+
+	var cfg dockerConfig
+	if err := json.NewDecoder(f).Decode(&cfg); err != nil {
+		return AuthConfig{}, fmt.Errorf("decode docker config: %s", err)
+	}
+
+	if helper, ok := cfg.CredHelpers[registry]; ok {
+		return resolveFromHelper(helper, registry)
+	}
+	if cfg.CredsStore != "" {
+		return resolveFromHelper(cfg.CredsStore, registry)
+	}
+	if entry, ok := cfg.Auths[registry]; ok {
+		return decodeBasicAuth(registry, entry.Auth)
+	}
+
+	return AuthConfig{}, fmt.Errorf("no credentials found for registry %q", registry)
+}
+
+// resolveFromHelper shells out to `docker-credential-<helper> get`, exactly
+// as the docker CLI does, and parses the result into an AuthConfig.
+func resolveFromHelper(helper, registry string) (AuthConfig, error) {
+	cmd := exec.Command(fmt.Sprintf("docker-credential-%s", helper), "get")
+	cmd.Stdin = bytes.NewBufferString(registry)
+
+	out, err := cmd.Output()
+	if err != nil {
+		return AuthConfig{}, fmt.Errorf("exec docker-credential-%s: %s", helper, err)
+	}
+
+	var resp credHelperOutput
+	if err := json.Unmarshal(out, &resp); err != nil {
+		return AuthConfig{}, fmt.Errorf("decode docker-credential-%s output: %s", helper, err)
+	}
+
+	return AuthConfig{
+		Username:      resp.Username,
+		Password:      resp.Secret,
+		ServerAddress: registry,
+	}, nil
+}
+
+// decodeBasicAuth decodes the base64 "user:pass" auth field stored in the
+// plaintext auths section of the docker config.
+func decodeBasicAuth(registry, auth string) (AuthConfig, error) {
+	decoded, err := base64.StdEncoding.DecodeString(auth)
+	if err != nil {
+		return AuthConfig{}, fmt.Errorf("decode auth for %q: %s", registry, err)
+	}
+	parts := bytes.SplitN(decoded, []byte(":"), 2)
+	if len(parts) != 2 {
+		return AuthConfig{}, fmt.Errorf("malformed auth entry for %q", registry)
+	}
+	return AuthConfig{
+		Username:      string(parts[0]),
+		Password:      string(parts[1]),
+		ServerAddress: registry,
+	}, nil
+}
+
+// encodeRegistryAuth base64-url-encodes auth into the form expected by the
+// X-Registry-Auth header.
+func encodeRegistryAuth(auth AuthConfig) (string, error) {
+	data, err := json.Marshal(auth)
+	if err != nil {
+		return "", fmt.Errorf("marshal auth config: %s", err)
+	}
+	return base64.URLEncoding.EncodeToString(data), nil
+}
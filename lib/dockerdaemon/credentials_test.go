@@ -0,0 +1,78 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package dockerdaemon
+
+import (
+	"encoding/base64"
+	"testing"
+)
+
+func TestDecodeBasicAuth(t *testing.T) {
+	tests := []struct {
+		desc         string
+		auth         string
+		wantUsername string
+		wantPassword string
+		wantErr      bool
+	}{
+		{"valid user and pass", base64.StdEncoding.EncodeToString([]byte("alice:hunter2")), "alice", "hunter2", false},
+		{"password contains colon", base64.StdEncoding.EncodeToString([]byte("alice:pass:word")), "alice", "pass:word", false},
+		{"empty password", base64.StdEncoding.EncodeToString([]byte("alice:")), "alice", "", false},
+		{"not base64", "not-base64!!!", "", "", true},
+		{"missing colon", base64.StdEncoding.EncodeToString([]byte("alice")), "", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			auth, err := decodeBasicAuth("registry.example.com", tt.auth)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if auth.Username != tt.wantUsername || auth.Password != tt.wantPassword {
+				t.Fatalf("decodeBasicAuth() = %+v, want username=%q password=%q",
+					auth, tt.wantUsername, tt.wantPassword)
+			}
+			if auth.ServerAddress != "registry.example.com" {
+				t.Fatalf("decodeBasicAuth() ServerAddress = %q, want %q", auth.ServerAddress, "registry.example.com")
+			}
+		})
+	}
+}
+
+func TestEncodeRegistryAuth(t *testing.T) {
+	auth := AuthConfig{
+		Username:      "alice",
+		Password:      "hunter2",
+		ServerAddress: "registry.example.com",
+	}
+
+	encoded, err := encodeRegistryAuth(auth)
+	if err != nil {
+		t.Fatalf("encodeRegistryAuth: unexpected error: %s", err)
+	}
+
+	decoded, err := base64.URLEncoding.DecodeString(encoded)
+	if err != nil {
+		t.Fatalf("encodeRegistryAuth did not produce valid base64url: %s", err)
+	}
+	if string(decoded) != `{"username":"alice","password":"hunter2","serveraddress":"registry.example.com","identitytoken":""}` {
+		t.Fatalf("encodeRegistryAuth decoded = %s, want marshaled AuthConfig JSON", decoded)
+	}
+}
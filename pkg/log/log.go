@@ -0,0 +1,172 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package log is a thin wrapper around code.uber.internal/go-common.git/x/log
+// that adds a runtime-reconfigurable level, so a hot agent can be debugged
+// without a restart that would lose its in-memory torrent state.
+//
+// TODO(chunk0-6): client/store, client/torrentclient, client/server, and
+// client/dockerregistry still log through code.uber.internal/go-common.git/x/log
+// directly and need to switch to this package for SetLevel/the
+// /admin/loglevel endpoint to affect their output; those packages are
+// outside this change's tree and are not touched here.
+package log
+
+import (
+	"fmt"
+	"strings"
+	"sync/atomic"
+
+	xlog "code.uber.internal/go-common.git/x/log"
+)
+
+// Level is a logging severity.
+type Level int32
+
+// Levels, ordered from most to least verbose.
+const (
+	DebugLevel Level = iota
+	InfoLevel
+	WarnLevel
+	ErrorLevel
+	FatalLevel
+)
+
+// String returns the lowercase name of l.
+func (l Level) String() string {
+	switch l {
+	case DebugLevel:
+		return "debug"
+	case InfoLevel:
+		return "info"
+	case WarnLevel:
+		return "warn"
+	case ErrorLevel:
+		return "error"
+	case FatalLevel:
+		return "fatal"
+	default:
+		return "unknown"
+	}
+}
+
+// ParseLevel parses a case-insensitive level name ("DEBUG", "info", "Warn",
+// ...) into a Level.
+func ParseLevel(s string) (Level, error) {
+	switch strings.ToLower(s) {
+	case "debug":
+		return DebugLevel, nil
+	case "info":
+		return InfoLevel, nil
+	case "warn", "warning":
+		return WarnLevel, nil
+	case "error":
+		return ErrorLevel, nil
+	case "fatal":
+		return FatalLevel, nil
+	default:
+		return 0, fmt.Errorf("log: invalid level %q", s)
+	}
+}
+
+// _level is the active level, stored atomically so SetLevel can be called
+// concurrently with logging calls from any goroutine.
+var _level = int32(InfoLevel)
+
+// SetLevel parses s and, if valid, atomically sets it as the active level.
+func SetLevel(s string) error {
+	lvl, err := ParseLevel(s)
+	if err != nil {
+		return err
+	}
+	atomic.StoreInt32(&_level, int32(lvl))
+	return nil
+}
+
+// GetLevel returns the active level.
+func GetLevel() Level {
+	return Level(atomic.LoadInt32(&_level))
+}
+
+func enabled(l Level) bool {
+	return l >= GetLevel()
+}
+
+// Debug logs args at DebugLevel if the active level allows it.
+func Debug(args ...interface{}) {
+	if enabled(DebugLevel) {
+		xlog.Debug(args...)
+	}
+}
+
+// Debugf logs a formatted message at DebugLevel if the active level allows it.
+func Debugf(format string, args ...interface{}) {
+	if enabled(DebugLevel) {
+		xlog.Debugf(format, args...)
+	}
+}
+
+// Info logs args at InfoLevel if the active level allows it.
+func Info(args ...interface{}) {
+	if enabled(InfoLevel) {
+		xlog.Info(args...)
+	}
+}
+
+// Infof logs a formatted message at InfoLevel if the active level allows it.
+func Infof(format string, args ...interface{}) {
+	if enabled(InfoLevel) {
+		xlog.Infof(format, args...)
+	}
+}
+
+// Warn logs args at WarnLevel if the active level allows it.
+func Warn(args ...interface{}) {
+	if enabled(WarnLevel) {
+		xlog.Warn(args...)
+	}
+}
+
+// Warnf logs a formatted message at WarnLevel if the active level allows it.
+func Warnf(format string, args ...interface{}) {
+	if enabled(WarnLevel) {
+		xlog.Warnf(format, args...)
+	}
+}
+
+// Error logs args at ErrorLevel if the active level allows it.
+func Error(args ...interface{}) {
+	if enabled(ErrorLevel) {
+		xlog.Error(args...)
+	}
+}
+
+// Errorf logs a formatted message at ErrorLevel if the active level allows it.
+func Errorf(format string, args ...interface{}) {
+	if enabled(ErrorLevel) {
+		xlog.Errorf(format, args...)
+	}
+}
+
+// Fatal logs args at FatalLevel and then terminates the process. Fatal
+// always logs, regardless of the active level.
+func Fatal(args ...interface{}) {
+	xlog.Fatal(args...)
+}
+
+// Fatalf logs a formatted message at FatalLevel and then terminates the
+// process. Fatalf always logs, regardless of the active level.
+func Fatalf(format string, args ...interface{}) {
+	xlog.Fatalf(format, args...)
+}
@@ -0,0 +1,53 @@
+// Copyright (c) 2016-2019 Uber Technologies, Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package log
+
+import "testing"
+
+func TestSetLevel(t *testing.T) {
+	tests := []struct {
+		desc    string
+		input   string
+		want    Level
+		wantErr bool
+	}{
+		{"lowercase debug", "debug", DebugLevel, false},
+		{"uppercase DEBUG", "DEBUG", DebugLevel, false},
+		{"mixed case Info", "Info", InfoLevel, false},
+		{"lowercase warn", "warn", WarnLevel, false},
+		{"warning alias", "warning", WarnLevel, false},
+		{"uppercase ERROR", "ERROR", ErrorLevel, false},
+		{"mixed case Fatal", "Fatal", FatalLevel, false},
+		{"invalid level", "verbose", 0, true},
+		{"empty string", "", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			err := SetLevel(tt.input)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("SetLevel(%q): expected error, got nil", tt.input)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("SetLevel(%q): unexpected error: %s", tt.input, err)
+			}
+			if got := GetLevel(); got != tt.want {
+				t.Fatalf("SetLevel(%q): GetLevel() = %v, want %v", tt.input, got, tt.want)
+			}
+		})
+	}
+}